@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+	"github.com/kkdai/youtube/v2"
+)
+
+// progressReader wraps an io.Reader and reports bytes read so far against an
+// expected total, so callers can surface upload/download progress without
+// threading state through the copy itself.
+type progressReader struct {
+	r          io.Reader
+	read       int64
+	total      int64
+	onProgress func(read, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		if p.onProgress != nil {
+			p.onProgress(p.read, p.total)
+		}
+	}
+	return n, err
+}
+
+// ingestProgress is a single SSE event published while a YouTube ingest job
+// streams in.
+type ingestProgress struct {
+	Read  int64  `json:"read"`
+	Total int64  `json:"total"`
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// ingestProgressBroker fans out progress events for in-flight ingest jobs so
+// handlerIngestProgress can subscribe independently of handlerIngestFromYouTube.
+type ingestProgressBroker struct {
+	mu   sync.Mutex
+	subs map[uuid.UUID][]chan ingestProgress
+}
+
+func newIngestProgressBroker() *ingestProgressBroker {
+	return &ingestProgressBroker{subs: make(map[uuid.UUID][]chan ingestProgress)}
+}
+
+func (b *ingestProgressBroker) subscribe(videoID uuid.UUID) chan ingestProgress {
+	ch := make(chan ingestProgress, 16)
+	b.mu.Lock()
+	b.subs[videoID] = append(b.subs[videoID], ch)
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *ingestProgressBroker) publish(videoID uuid.UUID, event ingestProgress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.subs[videoID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	if event.Done {
+		for _, ch := range b.subs[videoID] {
+			close(ch)
+		}
+		delete(b.subs, videoID)
+	}
+}
+
+type ingestFromYouTubeParams struct {
+	VideoID    uuid.UUID `json:"video_id"`
+	YouTubeURL string    `json:"youtube_url"`
+}
+
+// handlerIngestFromYouTube handles POST /api/video_ingest. It resolves the
+// best progressive MP4 stream for the given YouTube URL and runs it through
+// the same temp-file -> ffprobe -> faststart -> S3 pipeline as a direct
+// upload, without buffering the whole download in memory.
+func (cfg *apiConfig) handlerIngestFromYouTube(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params ingestFromYouTubeParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	videoMetadata, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Video with given ID not found", err)
+		return
+	}
+	if videoMetadata.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the video owner", nil)
+		return
+	}
+
+	client := youtube.Client{}
+	ytVideo, err := client.GetVideo(params.YouTubeURL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't resolve YouTube video", err)
+		return
+	}
+
+	formats := ytVideo.Formats.Type("video/mp4").WithAudioChannels()
+	if len(formats) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No progressive MP4 stream available", nil)
+		return
+	}
+	best := formats[0]
+
+	stream, contentLength, err := client.GetStream(ytVideo, &best)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open YouTube stream", err)
+		return
+	}
+	defer stream.Close()
+
+	tempFile, err := os.CreateTemp("", "tubely-ingest.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	pr := &progressReader{
+		r:     stream,
+		total: contentLength,
+		onProgress: func(read, total int64) {
+			cfg.ingestProgress.publish(params.VideoID, ingestProgress{Read: read, Total: total})
+		},
+	}
+
+	if _, err := io.Copy(tempFile, pr); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't stream YouTube video", err)
+		cfg.ingestProgress.publish(params.VideoID, ingestProgress{Done: true, Error: err.Error()})
+		return
+	}
+	tempFile.Seek(0, io.SeekStart)
+
+	probe, err := probeVideo(tempFile.Name())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+	if !allowedVideoCodecs[probe.VideoCodec] || probe.FormatName != allowedContainerFormat {
+		respondWithUnsupportedMediaType(w, "youtube ingest", probe.FormatName, probe.VideoCodec, probe.AudioCodec)
+		return
+	}
+
+	randomID := make([]byte, 32, 32)
+	rand.Read(randomID)
+	randomIDString := base64.RawURLEncoding.EncodeToString(randomID)
+	key := fmt.Sprintf("%s/%s.mp4", aspectRatioBucket(probe.Width, probe.Height), randomIDString)
+
+	fastStartFileName, err := processVideoForFastStart(tempFile.Name())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	fastStartFile, err := os.Open(fastStartFileName)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+	defer os.Remove(fastStartFile.Name())
+	defer fastStartFile.Close()
+
+	mediaType := "video/mp4"
+	if err := cfg.fileStore.Put(r.Context(), key, fastStartFile, mediaType); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not put object to storage", err)
+		return
+	}
+
+	updatedVid := database.Video{
+		ID:                videoMetadata.ID,
+		CreatedAt:         videoMetadata.CreatedAt,
+		UpdatedAt:         videoMetadata.UpdatedAt,
+		ThumbnailURL:      fallbackThumbnailURL(videoMetadata.ThumbnailURL, ytVideo),
+		VideoURL:          &key,
+		Width:             probe.Width,
+		Height:            probe.Height,
+		Duration:          probe.Duration,
+		VideoCodec:        probe.VideoCodec,
+		AudioCodec:        probe.AudioCodec,
+		PlaybackManifests: videoMetadata.PlaybackManifests,
+		CreateVideoParams: fillMetadataFromYouTube(videoMetadata.CreateVideoParams, ytVideo),
+	}
+
+	if err := cfg.db.UpdateVideo(updatedVid); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		cfg.ingestProgress.publish(params.VideoID, ingestProgress{Done: true, Error: err.Error()})
+		return
+	}
+
+	cfg.ingestProgress.publish(params.VideoID, ingestProgress{Read: contentLength, Total: contentLength, Done: true})
+
+	updatedVid, err = cfg.dbVideoToSignedVideo(updatedVid)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updatedVid)
+}
+
+// fillMetadataFromYouTube backfills title/description from the source video
+// when the caller hasn't already set them.
+func fillMetadataFromYouTube(params database.CreateVideoParams, ytVideo *youtube.Video) database.CreateVideoParams {
+	if params.Title == "" {
+		params.Title = ytVideo.Title
+	}
+	if params.Description == "" {
+		params.Description = ytVideo.Description
+	}
+	return params
+}
+
+func fallbackThumbnailURL(existing *string, ytVideo *youtube.Video) *string {
+	if existing != nil {
+		return existing
+	}
+	if len(ytVideo.Thumbnails) == 0 {
+		return nil
+	}
+	url := ytVideo.Thumbnails[len(ytVideo.Thumbnails)-1].URL
+	return &url
+}
+
+// handlerIngestProgress serves GET /api/video_ingest/{id}/progress over
+// Server-Sent Events, relaying progressReader updates published by
+// handlerIngestFromYouTube for the given video ID.
+func (cfg *apiConfig) handlerIngestProgress(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("id")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming unsupported", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := cfg.ingestProgress.subscribe(videoID)
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", payload)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerServeRendition handles GET /api/videos/{videoID}/renditions/{path...}.
+// HLS and DASH manifests address their own children (sub-playlists,
+// segments) by relative path, so those children can't carry their own
+// presigned URL. Instead every rendition asset is proxied through this
+// authenticated endpoint, keyed on the same renditions/{videoID}/... prefix
+// the transcode queue uploaded them under.
+func (cfg *apiConfig) handlerServeRendition(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	videoMetadata, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Video with given ID not found", err)
+		return
+	}
+	if videoMetadata.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the video owner", nil)
+		return
+	}
+
+	assetPath := path.Clean("/" + r.PathValue("path"))
+	if strings.Contains(assetPath, "..") {
+		respondWithError(w, http.StatusBadRequest, "Invalid asset path", nil)
+		return
+	}
+	key := fmt.Sprintf("renditions/%s%s", videoID, assetPath)
+
+	asset, err := cfg.fileStore.Get(r.Context(), key)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Rendition asset not found", err)
+		return
+	}
+	defer asset.Close()
+
+	w.Header().Set("Content-Type", renditionContentType(assetPath))
+	io.Copy(w, asset)
+}
+
+// renditionContentType mirrors the content types the transcode queue
+// uploads rendition files with, so player requests proxied through
+// handlerServeRendition see the same headers they would from the store.
+func renditionContentType(assetPath string) string {
+	switch {
+	case strings.HasSuffix(assetPath, ".m3u8"):
+		return "application/vnd.apple.mpegurl"
+	case strings.HasSuffix(assetPath, ".mpd"):
+		return "application/dash+xml"
+	case strings.HasSuffix(assetPath, ".m4s"), strings.HasSuffix(assetPath, ".mp4"):
+		return "video/mp4"
+	default:
+		return "application/octet-stream"
+	}
+}
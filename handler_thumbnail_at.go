@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerRegenerateThumbnailAt handles POST /api/videos/{id}/thumbnail_at?ts=SECONDS.
+// It re-derives the thumbnail from the video's already-uploaded source at an
+// arbitrary timestamp, replacing whatever ThumbnailURL is currently set.
+func (cfg *apiConfig) handlerRegenerateThumbnailAt(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("id")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	ts, err := strconv.ParseFloat(r.URL.Query().Get("ts"), 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ts query parameter", err)
+		return
+	}
+
+	videoMetadata, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Video with given ID not found", err)
+		return
+	}
+	if videoMetadata.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the video owner", nil)
+		return
+	}
+	if videoMetadata.VideoURL == nil {
+		respondWithError(w, http.StatusBadRequest, "Video has no uploaded source to seek", nil)
+		return
+	}
+
+	source, err := cfg.fileStore.Get(r.Context(), *videoMetadata.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read video source", err)
+		return
+	}
+	defer source.Close()
+
+	tempFile, err := os.CreateTemp("", "tubely-thumbnail-source.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, source); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	outPath := fmt.Sprintf("%s.thumb.jpg", tempFile.Name())
+	defer os.Remove(outPath)
+
+	if err := extractThumbnail(tempFile.Name(), ts, outPath); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't extract thumbnail", err)
+		return
+	}
+
+	thumbFile, err := os.Open(outPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+	defer thumbFile.Close()
+
+	key := fmt.Sprintf("thumbnails/%s.jpg", videoID)
+	if err := cfg.fileStore.Put(r.Context(), key, thumbFile, "image/jpeg"); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store thumbnail", err)
+		return
+	}
+
+	videoMetadata.ThumbnailURL = &key
+	if err := cfg.db.UpdateVideo(videoMetadata); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(videoMetadata)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
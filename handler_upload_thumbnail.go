@@ -3,11 +3,7 @@ package main
 import (
 	"fmt"
 	"io"
-	"mime"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
@@ -44,19 +40,29 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	file, header, err := r.FormFile("thumbnail")
+	file, _, err := r.FormFile("thumbnail")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error reading thumbnail", err)
 		return
 	}
 	defer file.Close()
 
-	extension, err := getExtensionFromHeader(header)
+	sniffBuf := make([]byte, 512)
+	n, err := io.ReadFull(file, sniffBuf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read thumbnail", err)
+		return
+	}
+	sniffedType := http.DetectContentType(sniffBuf[:n])
+	extension, err := extensionFromContentType(sniffedType)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Wrong header", err)
+		respondWithUnsupportedMediaType(w, "thumbnail upload", sniffedType, "", "")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
 		return
 	}
-	filename := fmt.Sprintf("%s.%s", videoID, extension)
 
 	videoMetadata, err := cfg.db.GetVideo(videoID)
 	if err != nil {
@@ -69,30 +75,14 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	filePath := filepath.Join(cfg.assetsRoot, filename)
-
-	createdFile, err := os.Create(filePath)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating file", err)
+	key := fmt.Sprintf("thumbnails/%s.%s", videoID, extension)
+	if err := cfg.fileStore.Put(r.Context(), key, file, sniffedType); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store thumbnail", err)
 		return
 	}
-	defer createdFile.Close()
-	_, err = io.Copy(createdFile, io.Reader(file))
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating file", err)
-		return
-	}
-
-	thumbnailUrl := fmt.Sprintf("/assets/%s", filename)
 
-	video := database.Video{
-		ID:                videoID,
-		CreatedAt:         videoMetadata.CreatedAt,
-		UpdatedAt:         videoMetadata.UpdatedAt,
-		ThumbnailURL:      &thumbnailUrl,
-		VideoURL:          videoMetadata.VideoURL,
-		CreateVideoParams: videoMetadata.CreateVideoParams,
-	}
+	video := videoMetadata
+	video.ThumbnailURL = &key
 
 	err = cfg.db.UpdateVideo(video)
 	if err != nil {
@@ -100,14 +90,21 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, signedVideo)
 }
 
-func getExtensionFromHeader(header *multipart.FileHeader) (string, error) {
-	contentHeader := header.Header.Get("Content-Type")
-	mediaType, _, err := mime.ParseMediaType(contentHeader)
-	if (mediaType != "image/jpeg" && mediaType != "image/png") || err != nil {
-		return "", fmt.Errorf("Wrong media type")
+// extensionFromContentType maps a sniffed image content type to the file
+// extension handlerUploadThumbnail stores it under, rejecting anything that
+// isn't a JPEG or PNG regardless of what the client claimed.
+func extensionFromContentType(mediaType string) (string, error) {
+	if mediaType != "image/jpeg" && mediaType != "image/png" {
+		return "", fmt.Errorf("wrong media type")
 	}
 	splitType := strings.SplitN(mediaType, "/", 2)
 
@@ -9,16 +9,16 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"mime"
 	"net/http"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/filestore"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcode"
 	"github.com/google/uuid"
 )
 
@@ -56,18 +56,29 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	videoFile, header, err := r.FormFile("video")
+	videoFile, _, err := r.FormFile("video")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error parsing multipart form", err)
 		return
 	}
 	defer videoFile.Close()
 
-	mediaType, _, err := mime.ParseMediaType(header.Header.Get("Content-Type"))
-	if mediaType != "video/mp4" || err != nil {
-		respondWithError(w, http.StatusBadRequest, "Could not verify filetype as mp4", err)
+	sniffBuf := make([]byte, 512)
+	n, err := io.ReadFull(videoFile, sniffBuf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read uploaded file", err)
 		return
 	}
+	sniffedType := http.DetectContentType(sniffBuf[:n])
+	if sniffedType != "video/mp4" {
+		respondWithUnsupportedMediaType(w, "video upload", sniffedType, "", "")
+		return
+	}
+	if _, err := videoFile.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+	mediaType := sniffedType
 
 	tempFile, err := os.CreateTemp("", "tubely-upload.mp4")
 	if err != nil {
@@ -77,19 +88,37 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
-	io.Copy(tempFile, videoFile)
+	contentLength, err := io.Copy(tempFile, videoFile)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
 	tempFile.Seek(0, io.SeekStart)
 
-	aspectRatio, err := getVideoAspectRatio(tempFile.Name())
+	probe, err := probeVideo(tempFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
 		return
 	}
 
+	if !allowedVideoCodecs[probe.VideoCodec] || probe.FormatName != allowedContainerFormat {
+		respondWithUnsupportedMediaType(w, "video upload", probe.FormatName, probe.VideoCodec, probe.AudioCodec)
+		return
+	}
+
+	thumbnailURL := videoMetadata.ThumbnailURL
+	if thumbnailURL == nil {
+		thumbnailURL, err = cfg.generateAndStoreThumbnail(r.Context(), videoID, tempFile.Name(), probe.Duration)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+			return
+		}
+	}
+
 	randomID := make([]byte, 32, 32)
 	rand.Read(randomID)
 	randomIDString := base64.RawURLEncoding.EncodeToString(randomID)
-	key := fmt.Sprintf("%s/%s.mp4", aspectRatio, randomIDString)
+	key := fmt.Sprintf("%s/%s.mp4", aspectRatioBucket(probe.Width, probe.Height), randomIDString)
 
 	fastStartFileName, err := processVideoForFastStart(tempFile.Name())
 	if err != nil {
@@ -102,29 +131,29 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
 		return
 	}
-	defer os.Remove(fastStartFile.Name())
+	// Ownership of fastStartFileName passes to the transcode queue below, so
+	// it is not removed here; the queue worker deletes it once the ABR job
+	// finishes with it.
 	defer fastStartFile.Close()
 
-	params := s3.PutObjectInput{
-		Bucket:      &cfg.s3Bucket,
-		Key:         &key,
-		Body:        fastStartFile,
-		ContentType: &mediaType,
-	}
-
-	_, err = cfg.s3Client.PutObject(r.Context(), &params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not put object to S3", err)
+	if err := cfg.fileStore.Put(r.Context(), key, fastStartFile, mediaType); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not put object to storage", err)
+		return
 	}
 
-	videoURL := fmt.Sprintf("%s,%s", cfg.s3Bucket, key)
-
 	updatedVid := database.Video{
 		ID:                videoMetadata.ID,
 		CreatedAt:         videoMetadata.CreatedAt,
 		UpdatedAt:         videoMetadata.UpdatedAt,
-		ThumbnailURL:      videoMetadata.ThumbnailURL,
-		VideoURL:          &videoURL,
+		ThumbnailURL:      thumbnailURL,
+		VideoURL:          &key,
+		Width:             probe.Width,
+		Height:            probe.Height,
+		Duration:          probe.Duration,
+		VideoCodec:        probe.VideoCodec,
+		AudioCodec:        probe.AudioCodec,
+		ContentLength:     contentLength,
+		PlaybackManifests: videoMetadata.PlaybackManifests,
 		CreateVideoParams: videoMetadata.CreateVideoParams,
 	}
 
@@ -134,53 +163,235 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	updatedVid, err = cfg.dbVideoToSignedVideo(updatedVid)
+	job := cfg.transcodeQueue.Enqueue(videoMetadata.ID, fastStartFile.Name())
+
+	respondWithJSON(w, http.StatusAccepted, transcodeJobResponse{
+		VideoID: videoMetadata.ID,
+		JobID:   job.ID,
+		Status:  string(transcode.StatusQueued),
+	})
+}
+
+// transcodeJobResponse is returned immediately from handlerUploadVideo so the
+// client can poll handlerGetTranscodeJobStatus while the ABR ladder renders
+// in the background.
+type transcodeJobResponse struct {
+	VideoID uuid.UUID `json:"video_id"`
+	JobID   uuid.UUID `json:"job_id"`
+	Status  string    `json:"status"`
+}
+
+// handlerGetTranscodeJobStatus serves GET /api/videos/{videoID}/transcode/{jobID}
+// so clients can poll the async ABR pipeline kicked off by handlerUploadVideo.
+func (cfg *apiConfig) handlerGetTranscodeJobStatus(w http.ResponseWriter, r *http.Request) {
+	jobIDString := r.PathValue("jobID")
+	jobID, err := uuid.Parse(jobIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID", err)
+		return
+	}
+
+	job, ok := cfg.transcodeQueue.Status(jobID)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Job not found", nil)
+		return
+	}
+
+	status, manifests, jobErr := job.Snapshot()
+	resp := transcodeJobResponse{VideoID: job.VideoID, JobID: job.ID, Status: string(status)}
+
+	if jobErr != nil {
+		respondWithError(w, http.StatusInternalServerError, "Transcode job failed", jobErr)
+		return
+	}
+
+	if manifests == nil {
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+	video.PlaybackManifests = &database.PlaybackManifests{
+		HLSURL:        manifests.HLSKey,
+		DASHURL:       manifests.DASHKey,
+		RenditionKeys: manifests.RenditionKeys,
+		JobStatus:     string(status),
+	}
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, updatedVid)
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// videoProbe is the subset of ffprobe's streams+format output that the
+// upload pipeline cares about: dimensions, duration, codecs, and container.
+type videoProbe struct {
+	Width      int
+	Height     int
+	Duration   float64
+	VideoCodec string
+	AudioCodec string
+	BitRate    int64
+	FormatName string
+}
+
+// allowedVideoCodecs are the codecs handlerUploadVideo will accept; anything
+// else is rejected with 415 rather than silently re-encoded.
+var allowedVideoCodecs = map[string]bool{
+	"h264": true,
+	"hevc": true,
 }
 
-func getVideoAspectRatio(filepath string) (string, error) {
+// allowedContainerFormat is ffprobe's format_name for the MP4 family of
+// containers (it reports all aliases the demuxer recognizes at once).
+const allowedContainerFormat = "mov,mp4,m4a,3gp,3g2,mj2"
+
+// probeVideo runs a single ffprobe invocation over both streams and format
+// so handlerUploadVideo doesn't need to shell out multiple times per upload.
+func probeVideo(filepath string) (*videoProbe, error) {
 	var output bytes.Buffer
 
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filepath)
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filepath)
 	cmd.Stdout = &output
 
-	err := cmd.Run()
-	if err != nil {
-		return "", err
+	if err := cmd.Run(); err != nil {
+		return nil, err
 	}
 
 	var data struct {
 		Streams []struct {
-			Width  int `json:"width"`
-			Height int `json:"height"`
+			CodecName string `json:"codec_name"`
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
 		} `json:"streams"`
+		Format struct {
+			Duration   string `json:"duration"`
+			BitRate    string `json:"bit_rate"`
+			FormatName string `json:"format_name"`
+		} `json:"format"`
 	}
 
 	if err := json.Unmarshal(output.Bytes(), &data); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if len(data.Streams) == 0 {
-		return "", nil
+	probe := &videoProbe{FormatName: data.Format.FormatName}
+	fmt.Sscanf(data.Format.Duration, "%f", &probe.Duration)
+	fmt.Sscanf(data.Format.BitRate, "%d", &probe.BitRate)
+
+	for _, s := range data.Streams {
+		switch s.CodecType {
+		case "video":
+			probe.VideoCodec = s.CodecName
+			probe.Width = s.Width
+			probe.Height = s.Height
+		case "audio":
+			probe.AudioCodec = s.CodecName
+		}
 	}
 
-	aspectRatio := float64(data.Streams[0].Width) / float64(data.Streams[0].Height)
+	return probe, nil
+}
+
+// aspectRatioBucket classifies a width/height pair into the coarse buckets
+// used for the S3 key prefix ("landscape"/"portrait"/"other").
+func aspectRatioBucket(width, height int) string {
+	if height == 0 {
+		return "other"
+	}
+
+	aspectRatio := float64(width) / float64(height)
 	tolerance := 0.1
 	landscapeRatio := float64(16) / float64(9)
 	portraitRatio := float64(9) / float64(16)
 
 	if math.Abs(aspectRatio-landscapeRatio) < tolerance {
-		return "landscape", nil
+		return "landscape"
 	} else if math.Abs(aspectRatio-portraitRatio) < tolerance {
-		return "portrait", nil
+		return "portrait"
 	}
 
-	return "other", nil
+	return "other"
+}
+
+// unsupportedMediaError is the structured 415 body returned when content
+// sniffing or ffprobe validation rejects an upload.
+type unsupportedMediaError struct {
+	Context            string `json:"context"`
+	DetectedContainer  string `json:"detected_container"`
+	DetectedVideoCodec string `json:"detected_video_codec,omitempty"`
+	DetectedAudioCodec string `json:"detected_audio_codec,omitempty"`
+}
+
+func respondWithUnsupportedMediaType(w http.ResponseWriter, source, detectedContainer, detectedVideoCodec, detectedAudioCodec string) {
+	respondWithJSON(w, http.StatusUnsupportedMediaType, unsupportedMediaError{
+		Context:            source,
+		DetectedContainer:  detectedContainer,
+		DetectedVideoCodec: detectedVideoCodec,
+		DetectedAudioCodec: detectedAudioCodec,
+	})
+}
+
+// thumbnailWidth and thumbnailHeight are the dimensions used for
+// server-generated poster frames.
+const (
+	thumbnailWidth  = 177
+	thumbnailHeight = 100
+)
+
+// extractThumbnail runs ffmpeg to pull a single JPEG frame from videoPath at
+// atSeconds, scaled to thumbnailWidth x thumbnailHeight, into outPath.
+func extractThumbnail(videoPath string, atSeconds float64, outPath string) error {
+	cmd := exec.Command("ffmpeg", "-y",
+		"-ss", fmt.Sprintf("%f", atSeconds),
+		"-i", videoPath,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:%d", thumbnailWidth, thumbnailHeight),
+		"-f", "image2", outPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg thumbnail: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// generateAndStoreThumbnail extracts a poster frame at 10% of the video's
+// duration and uploads it to thumbnails/{videoID}.jpg, returning its key.
+func (cfg *apiConfig) generateAndStoreThumbnail(ctx context.Context, videoID uuid.UUID, videoPath string, duration float64) (*string, error) {
+	outPath := fmt.Sprintf("%s.thumb.jpg", videoPath)
+	defer os.Remove(outPath)
+
+	if err := extractThumbnail(videoPath, duration*0.1, outPath); err != nil {
+		return nil, err
+	}
+
+	thumbFile, err := os.Open(outPath)
+	if err != nil {
+		return nil, err
+	}
+	defer thumbFile.Close()
+
+	key := fmt.Sprintf("thumbnails/%s.jpg", videoID)
+	if err := cfg.fileStore.Put(ctx, key, thumbFile, "image/jpeg"); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
 }
 
 func processVideoForFastStart(filePath string) (string, error) {
@@ -196,36 +407,74 @@ func processVideoForFastStart(filePath string) (string, error) {
 	return outputFilePath, nil
 }
 
-func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
-	presignClient := s3.NewPresignClient(s3Client)
-
-	params := s3.GetObjectInput{
-		Bucket: &bucket,
-		Key:    &key,
-	}
-	presignedReq, err := presignClient.PresignGetObject(context.Background(), &params, s3.WithPresignExpires(expireTime))
-	if err != nil {
-		return "", err
-	}
+// fileStoreUploader adapts cfg.fileStore to transcode.Uploader so the
+// transcode queue can push rendition output without depending on a
+// particular storage backend.
+type fileStoreUploader struct {
+	fileStore filestore.FileStore
+}
 
-	return presignedReq.URL, nil
+func (u *fileStoreUploader) Upload(ctx context.Context, key string, body io.Reader, contentType string) error {
+	return u.fileStore.Put(ctx, key, body, contentType)
 }
 
+// dbVideoToSignedVideo turns the source video key and a store-keyed
+// thumbnail into time-limited signed URLs the client can fetch directly from
+// the store, and rewrites the HLS/DASH manifest keys and per-rendition
+// segment prefixes into handlerServeRendition paths. Absolute thumbnail URLs
+// are left as they are.
 func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
-	if video.VideoURL == nil {
-		return video, nil
+	presign := func(key string) (string, error) {
+		return cfg.fileStore.PresignGet(context.Background(), key, time.Duration(10)*time.Minute)
 	}
 
-	parts := strings.Split(*video.VideoURL, ",")
-	if len(parts) != 2 {
-		return database.Video{}, fmt.Errorf("Malformed video URL")
+	if video.VideoURL != nil {
+		signedVideoURL, err := presign(*video.VideoURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video.VideoURL = &signedVideoURL
 	}
 
-	signedVideoURL, err := generatePresignedURL(cfg.s3Client, parts[0], parts[1], time.Duration(10)*time.Minute)
-	if err != nil {
-		return database.Video{}, err
+	// ThumbnailURL is either a store key (uploaded or server-generated
+	// thumbnail) or an absolute URL falling back to a YouTube-hosted one;
+	// only the former needs presigning.
+	if video.ThumbnailURL != nil && !strings.HasPrefix(*video.ThumbnailURL, "http") {
+		signedThumbnailURL, err := presign(*video.ThumbnailURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video.ThumbnailURL = &signedThumbnailURL
+	}
+
+	// HLS/DASH manifests and their child playlists reference each other by
+	// relative path, so presigning the master/rendition keys individually
+	// would hand out URLs children can't resolve against (and, for
+	// RenditionKeys, a "key" that's really a segment-directory prefix, not
+	// an object PresignGet can sign at all). Route the whole rendition tree
+	// through handlerServeRendition instead, which re-authenticates and
+	// fetches each file from the store on demand.
+	if video.PlaybackManifests != nil {
+		manifests := *video.PlaybackManifests
+
+		manifests.HLSURL = cfg.renditionURL(video.ID, manifests.HLSURL)
+		manifests.DASHURL = cfg.renditionURL(video.ID, manifests.DASHURL)
+
+		renditionURLs := make(map[string]string, len(manifests.RenditionKeys))
+		for rendition, key := range manifests.RenditionKeys {
+			renditionURLs[rendition] = cfg.renditionURL(video.ID, key)
+		}
+		manifests.RenditionKeys = renditionURLs
+
+		video.PlaybackManifests = &manifests
 	}
 
-	video.VideoURL = &signedVideoURL
 	return video, nil
 }
+
+// renditionURL turns a renditions/{videoID}/... storage key (or prefix) into
+// the relative path handlerServeRendition serves it from.
+func (cfg *apiConfig) renditionURL(videoID uuid.UUID, key string) string {
+	prefix := fmt.Sprintf("renditions/%s/", videoID)
+	return fmt.Sprintf("/api/videos/%s/renditions/%s", videoID, strings.TrimPrefix(key, prefix))
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/filestore"
+	"github.com/google/uuid"
+)
+
+// multipartUploadIdleTimeout is how long an upload session can go without a
+// new part before the reaper aborts it in the file store and drops it from
+// the database.
+const multipartUploadIdleTimeout = 24 * time.Hour
+
+type initiateMultipartUploadParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+}
+
+type initiateMultipartUploadResponse struct {
+	UploadID string `json:"upload_id"`
+	Key      string `json:"key"`
+}
+
+// handlerInitiateMultipartUpload handles POST /api/video_uploads. It opens a
+// multipart upload in the configured file store for the given video and
+// persists a session row so the reaper can find and abort it if the client
+// disappears.
+func (cfg *apiConfig) handlerInitiateMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params initiateMultipartUploadParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	videoMetadata, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Video with given ID not found", err)
+		return
+	}
+	if videoMetadata.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the video owner", nil)
+		return
+	}
+
+	key := fmt.Sprintf("uploads/%s.mp4", params.VideoID)
+	uploadID, err := cfg.fileStore.InitMultipart(r.Context(), key, "video/mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create multipart upload", err)
+		return
+	}
+
+	session := database.UploadSession{
+		ID:        uuid.New(),
+		VideoID:   params.VideoID,
+		OwnerID:   userID,
+		Key:       key,
+		UploadID:  uploadID,
+		StartedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := cfg.db.CreateUploadSession(session); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't persist upload session", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, initiateMultipartUploadResponse{
+		UploadID: session.ID.String(),
+		Key:      key,
+	})
+}
+
+type uploadPartResponse struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// handlerUploadVideoPart handles PUT /api/video_uploads/{id}/parts/{n}. The
+// request body is the raw bytes of that part; it is forwarded to the file
+// store's UploadPart and the resulting ETag is recorded against the session
+// so CompleteMultipartUpload can be assembled later.
+func (cfg *apiConfig) handlerUploadVideoPart(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return
+	}
+	var partNumber int32
+	if _, err := fmt.Sscanf(r.PathValue("n"), "%d", &partNumber); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid part number", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	session, err := cfg.db.GetUploadSession(sessionID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Upload session not found", err)
+		return
+	}
+	if session.OwnerID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the upload owner", nil)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, 5<<30)
+	defer body.Close()
+
+	etag, err := cfg.fileStore.UploadPart(r.Context(), session.Key, session.UploadID, partNumber, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload part", err)
+		return
+	}
+
+	session.UpdatedAt = time.Now()
+	session.Parts = append(session.Parts, database.UploadPart{PartNumber: partNumber, ETag: etag})
+	if err := cfg.db.UpdateUploadSession(session); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't persist part", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, uploadPartResponse{PartNumber: partNumber, ETag: etag})
+}
+
+// handlerCompleteMultipartUpload handles POST /api/video_uploads/{id}/complete.
+// It assembles the recorded parts into a CompleteMultipartUpload call and, on
+// success, updates the video's VideoURL the same way handlerUploadVideo does.
+func (cfg *apiConfig) handlerCompleteMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	session, err := cfg.db.GetUploadSession(sessionID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Upload session not found", err)
+		return
+	}
+	if session.OwnerID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Not the upload owner", nil)
+		return
+	}
+
+	completedParts := completedPartsFrom(session.Parts)
+
+	if err := cfg.fileStore.CompleteMultipart(r.Context(), session.Key, session.UploadID, completedParts); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't complete multipart upload", err)
+		return
+	}
+
+	videoMetadata, err := cfg.db.GetVideo(session.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	videoMetadata.VideoURL = &session.Key
+	if err := cfg.db.UpdateVideo(videoMetadata); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	if err := cfg.db.DeleteUploadSession(session.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	updatedVid, err := cfg.dbVideoToSignedVideo(videoMetadata)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "An error occurred", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updatedVid)
+}
+
+// completedPartsFrom builds the ordered, deduplicated part list
+// CompleteMultipart requires out of a session's parts, which are recorded in
+// arrival order and may include more than one ETag for the same part number
+// if the client retried a PUT. The most recently recorded ETag for a given
+// part number wins.
+func completedPartsFrom(parts []database.UploadPart) []filestore.Part {
+	latest := make(map[int32]string, len(parts))
+	for _, p := range parts {
+		latest[p.PartNumber] = p.ETag
+	}
+
+	partNumbers := make([]int32, 0, len(latest))
+	for partNumber := range latest {
+		partNumbers = append(partNumbers, partNumber)
+	}
+	sort.Slice(partNumbers, func(i, j int) bool { return partNumbers[i] < partNumbers[j] })
+
+	completedParts := make([]filestore.Part, len(partNumbers))
+	for i, partNumber := range partNumbers {
+		completedParts[i] = filestore.Part{PartNumber: partNumber, ETag: latest[partNumber]}
+	}
+	return completedParts
+}
+
+// reapIdleMultipartUploads aborts and deletes any upload session that hasn't
+// received a new part in more than multipartUploadIdleTimeout. It is meant to
+// be run on a ticker from main.
+func (cfg *apiConfig) reapIdleMultipartUploads(ctx context.Context) error {
+	sessions, err := cfg.db.ListUploadSessions()
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if time.Since(session.UpdatedAt) < multipartUploadIdleTimeout {
+			continue
+		}
+
+		if err := cfg.fileStore.AbortMultipart(ctx, session.Key, session.UploadID); err != nil {
+			return fmt.Errorf("aborting idle upload %s: %w", session.ID, err)
+		}
+
+		if err := cfg.db.DeleteUploadSession(session.ID); err != nil {
+			return fmt.Errorf("deleting idle upload session %s: %w", session.ID, err)
+		}
+	}
+
+	return nil
+}
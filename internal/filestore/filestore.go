@@ -0,0 +1,32 @@
+// Package filestore abstracts the blob storage backend used for uploaded
+// video and thumbnail assets so handlers, tests, and local development don't
+// need to depend on the AWS SDK or real S3 credentials directly.
+package filestore
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// FileStore is the storage surface the HTTP handlers need: simple put/get,
+// presigned read URLs, and the multipart primitives needed for large,
+// resumable uploads.
+type FileStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+	Delete(ctx context.Context, key string) error
+
+	InitMultipart(ctx context.Context, key, contentType string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int32, r io.Reader) (etag string, err error)
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
+
+// Part identifies one completed part of a multipart upload by its 1-based
+// part number and the ETag S3 (or the local backend) returned for it.
+type Part struct {
+	PartNumber int32
+	ETag       string
+}
@@ -0,0 +1,292 @@
+// Package transcode drives ffmpeg to turn a single uploaded video into an
+// adaptive bitrate (ABR) ladder of fMP4 renditions plus HLS and DASH
+// manifests, and exposes a small in-memory job queue so the HTTP layer
+// doesn't have to block on the encode.
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Rendition describes one rung of the ABR ladder.
+type Rendition struct {
+	Name         string // e.g. "480p", used as the renditions/{videoID}/{Name} prefix
+	Width        int
+	Height       int
+	VideoBitrate string // ffmpeg -b:v value, e.g. "1400k"
+	AudioBitrate string // ffmpeg -b:a value, e.g. "128k"
+}
+
+// DefaultLadder is the standard 240p/480p/720p/1080p ladder used when a
+// caller doesn't supply its own.
+var DefaultLadder = []Rendition{
+	{Name: "240p", Width: 426, Height: 240, VideoBitrate: "400k", AudioBitrate: "64k"},
+	{Name: "480p", Width: 854, Height: 480, VideoBitrate: "1400k", AudioBitrate: "128k"},
+	{Name: "720p", Width: 1280, Height: 720, VideoBitrate: "2800k", AudioBitrate: "128k"},
+	{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: "5000k", AudioBitrate: "192k"},
+}
+
+// Status is the lifecycle of a transcode Job.
+type Status string
+
+const (
+	StatusQueued     Status = "queued"
+	StatusProcessing Status = "processing"
+	StatusComplete   Status = "complete"
+	StatusFailed     Status = "failed"
+)
+
+// Manifests holds the locations of the generated playback manifests and
+// per-rendition metadata, ready to be persisted on database.Video.
+type Manifests struct {
+	HLSKey        string
+	DASHKey       string
+	RenditionKeys map[string]string // ladder name -> segment prefix key
+}
+
+// Uploader is the minimal surface Queue needs to push rendition output to
+// whatever bucket the caller is using. A filestore.FileStore satisfies this
+// via a thin wrapper at the call site.
+type Uploader interface {
+	Upload(ctx context.Context, key string, body io.Reader, contentType string) error
+}
+
+// Job tracks one transcoding run so clients can poll for its outcome.
+type Job struct {
+	ID      uuid.UUID
+	VideoID uuid.UUID
+
+	sourcePath string
+
+	mu        sync.Mutex
+	status    Status
+	manifests *Manifests
+	err       error
+}
+
+func newJob(videoID uuid.UUID) *Job {
+	return &Job{ID: uuid.New(), VideoID: videoID, status: StatusQueued}
+}
+
+// Snapshot returns a point-in-time copy of the job's status, result, and error.
+func (j *Job) Snapshot() (Status, *Manifests, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status, j.manifests, j.err
+}
+
+func (j *Job) setStatus(s Status) {
+	j.mu.Lock()
+	j.status = s
+	j.mu.Unlock()
+}
+
+func (j *Job) finish(m *Manifests, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err != nil {
+		j.status = StatusFailed
+		j.err = err
+		return
+	}
+	j.status = StatusComplete
+	j.manifests = m
+}
+
+// Queue is a small in-memory worker pool for transcoding jobs. It is meant
+// to be long-lived for the lifetime of the server process; jobs are not
+// persisted across restarts.
+type Queue struct {
+	jobs     chan *Job
+	mu       sync.RWMutex
+	byID     map[uuid.UUID]*Job
+	ladder   []Rendition
+	uploader Uploader
+}
+
+// NewQueue starts workers goroutines draining the job channel.
+func NewQueue(workers int, uploader Uploader, ladder []Rendition) *Queue {
+	if ladder == nil {
+		ladder = DefaultLadder
+	}
+	q := &Queue{
+		jobs:     make(chan *Job, 64),
+		byID:     make(map[uuid.UUID]*Job),
+		ladder:   ladder,
+		uploader: uploader,
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// Enqueue submits sourcePath (a local fast-start mp4) for transcoding and
+// returns a Job the caller can poll via Status without waiting for the
+// encode. It blocks only while the queue's 64-job buffer is full.
+func (q *Queue) Enqueue(videoID uuid.UUID, sourcePath string) *Job {
+	job := newJob(videoID)
+	q.mu.Lock()
+	q.byID[job.ID] = job
+	q.mu.Unlock()
+
+	job.sourcePath = sourcePath
+	q.jobs <- job
+	return job
+}
+
+// Status looks up a previously enqueued job by ID.
+func (q *Queue) Status(id uuid.UUID) (*Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	job, ok := q.byID[id]
+	return job, ok
+}
+
+func (q *Queue) worker() {
+	for job := range q.jobs {
+		job.setStatus(StatusProcessing)
+		manifests, err := q.run(job)
+		job.finish(manifests, err)
+		os.Remove(job.sourcePath)
+	}
+}
+
+func (q *Queue) run(job *Job) (*Manifests, error) {
+	ctx := context.Background()
+	workDir, err := os.MkdirTemp("", "tubely-transcode")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	renditionKeys := make(map[string]string, len(q.ladder))
+	var variantLines []string
+
+	for _, r := range q.ladder {
+		segDir := filepath.Join(workDir, r.Name)
+		if err := os.MkdirAll(segDir, 0o755); err != nil {
+			return nil, err
+		}
+
+		playlistPath := filepath.Join(segDir, "stream.m3u8")
+		initPath := filepath.Join(segDir, "init.mp4")
+		segPattern := filepath.Join(segDir, "seg_%03d.m4s")
+
+		cmd := exec.Command("ffmpeg", "-i", job.sourcePath,
+			"-vf", fmt.Sprintf("scale=%d:%d", r.Width, r.Height),
+			"-c:v", "libx264", "-b:v", r.VideoBitrate,
+			"-c:a", "aac", "-b:a", r.AudioBitrate,
+			"-f", "hls", "-hls_segment_type", "fmp4",
+			"-hls_fmp4_init_filename", "init.mp4",
+			"-hls_segment_filename", segPattern,
+			playlistPath,
+		)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("ffmpeg rendition %s: %w: %s", r.Name, err, stderr.String())
+		}
+
+		keyPrefix := fmt.Sprintf("renditions/%s/%s", job.VideoID, r.Name)
+		if err := q.uploadDir(ctx, segDir, keyPrefix); err != nil {
+			return nil, err
+		}
+		renditionKeys[r.Name] = keyPrefix
+
+		bandwidth := bandwidthFromBitrates(r.VideoBitrate, r.AudioBitrate)
+		variantLines = append(variantLines,
+			fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/stream.m3u8", bandwidth, r.Width, r.Height, r.Name))
+
+		_ = initPath // retained on disk only long enough to be uploaded above
+	}
+
+	masterKey := fmt.Sprintf("renditions/%s/master.m3u8", job.VideoID)
+	if err := q.uploader.Upload(ctx, masterKey, masterPlaylist(variantLines), "application/vnd.apple.mpegurl"); err != nil {
+		return nil, err
+	}
+
+	dashKey := fmt.Sprintf("renditions/%s/manifest.mpd", job.VideoID)
+	if err := q.uploader.Upload(ctx, dashKey, dashManifest(q.ladder), "application/dash+xml"); err != nil {
+		return nil, err
+	}
+
+	return &Manifests{HLSKey: masterKey, DASHKey: dashKey, RenditionKeys: renditionKeys}, nil
+}
+
+func (q *Queue) uploadDir(ctx context.Context, dir, keyPrefix string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		err = q.uploader.Upload(ctx, fmt.Sprintf("%s/%s", keyPrefix, entry.Name()), f, contentTypeFor(entry.Name()))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contentTypeFor(name string) string {
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".m4s", ".mp4":
+		return "video/mp4"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func masterPlaylist(variantLines []string) *bytes.Reader {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n")
+	for _, line := range variantLines {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func dashManifest(ladder []Rendition) *bytes.Reader {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	buf.WriteString(`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static">` + "\n")
+	buf.WriteString("  <Period>\n    <AdaptationSet mimeType=\"video/mp4\" segmentAlignment=\"true\">\n")
+	for _, r := range ladder {
+		buf.WriteString(fmt.Sprintf("      <Representation id=%q width=%q height=%q bandwidth=%q/>\n",
+			r.Name, fmt.Sprint(r.Width), fmt.Sprint(r.Height), fmt.Sprint(bandwidthFromBitrates(r.VideoBitrate, r.AudioBitrate))))
+	}
+	buf.WriteString("    </AdaptationSet>\n  </Period>\n</MPD>\n")
+	return bytes.NewReader(buf.Bytes())
+}
+
+// bandwidthFromBitrates parses ffmpeg-style "1400k" bitrate strings and sums
+// them into a bits-per-second bandwidth value for the manifests.
+func bandwidthFromBitrates(bitrates ...string) int {
+	total := 0
+	for _, b := range bitrates {
+		var n int
+		fmt.Sscanf(b, "%dk", &n)
+		total += n * 1000
+	}
+	return total
+}